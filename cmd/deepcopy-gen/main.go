@@ -0,0 +1,252 @@
+// Command deepcopy-gen generates DeepCopyInto and Clone methods for struct
+// types annotated with a "//deepcopy:generate" comment directive, using
+// direct field assignment instead of reflection.
+//
+// Usage:
+//
+//	deepcopy-gen -pkg <dir>
+//
+// For every annotated type T declared in the package rooted at -pkg,
+// deepcopy-gen writes zz_generated.deepcopy.go containing:
+//
+//	func (t *T) DeepCopyInto(out *T)
+//	func (t *T) Clone() *T
+//
+// The deepcopy package's runtime already knows how to call a type's Clone
+// method (see cachedTypeMethod in deepcopy.go), so once a type is processed
+// by deepcopy-gen it's cloned without reflection, while every other type
+// still falls back to the reflective copy.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	pkgDir := "."
+	for i := 1; i < len(os.Args); i++ {
+		if os.Args[i] == "-pkg" && i+1 < len(os.Args) {
+			i++
+			pkgDir = os.Args[i]
+		}
+	}
+
+	if err := run(pkgDir); err != nil {
+		fmt.Fprintln(os.Stderr, "deepcopy-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(pkgDir string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, pkgDir, nil, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	for pkgName, pkg := range pkgs {
+		types := collectTypes(pkg)
+		if len(types) == 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "// Code generated by deepcopy-gen. DO NOT EDIT.\n\n")
+		fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+
+		for _, t := range types {
+			writeDeepCopyInto(&buf, t)
+			writeClone(&buf, t)
+		}
+
+		out, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s: %w", pkgName, err)
+		}
+
+		path := filepath.Join(pkgDir, "zz_generated.deepcopy.go")
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// structType is the subset of a type declaration deepcopy-gen needs to emit
+// DeepCopyInto and Clone for it.
+type structType struct {
+	name   string
+	fields []*ast.Field
+}
+
+// collectTypes finds every struct type in pkg whose declaration carries a
+// "//deepcopy:generate" directive in its doc comment.
+func collectTypes(pkg *ast.Package) []structType {
+	var types []structType
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE || !hasGenerateDirective(gd.Doc) {
+				continue
+			}
+
+			for _, spec := range gd.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				types = append(types, structType{
+					name:   ts.Name.Name,
+					fields: st.Fields.List,
+				})
+			}
+		}
+	}
+	return types
+}
+
+func hasGenerateDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.Contains(c.Text, "//deepcopy:generate") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeDeepCopyInto(buf *bytes.Buffer, t structType) {
+	fmt.Fprintf(buf, "// DeepCopyInto copies the receiver into out, using direct field\n")
+	fmt.Fprintf(buf, "// assignment instead of reflection.\n")
+	fmt.Fprintf(buf, "func (t *%s) DeepCopyInto(out *%s) {\n", t.name, t.name)
+	fmt.Fprintf(buf, "\t*out = *t\n")
+
+	for _, f := range t.fields {
+		for _, name := range fieldNames(f) {
+			writeFieldCopy(buf, name, f.Type)
+		}
+	}
+
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+// fieldNames returns f's declared names, or nil for an embedded field:
+// *out = *t in DeepCopyInto already copies it shallowly, and without a type
+// switch on f.Type we can't also recurse into it.
+func fieldNames(f *ast.Field) []string {
+	if len(f.Names) == 0 {
+		return nil
+	}
+	names := make([]string, len(f.Names))
+	for i, n := range f.Names {
+		names[i] = n.Name
+	}
+	return names
+}
+
+func writeFieldCopy(buf *bytes.Buffer, name string, typ ast.Expr) {
+	switch e := typ.(type) {
+	case *ast.StarExpr:
+		elem := exprString(e.X)
+		fmt.Fprintf(buf, "\tif t.%s != nil {\n", name)
+		fmt.Fprintf(buf, "\t\tout.%s = new(%s)\n", name, elem)
+		if isExported(e.X) {
+			fmt.Fprintf(buf, "\t\tt.%s.DeepCopyInto(out.%s)\n", name, name)
+		} else {
+			fmt.Fprintf(buf, "\t\t*out.%s = *t.%s\n", name, name)
+		}
+		fmt.Fprintf(buf, "\t}\n")
+
+	case *ast.ArrayType:
+		if e.Len != nil {
+			return // fixed-size array, already copied by value via *out = *t
+		}
+		elem := exprString(e.Elt)
+		fmt.Fprintf(buf, "\tif t.%s != nil {\n", name)
+		fmt.Fprintf(buf, "\t\tout.%s = make([]%s, len(t.%s))\n", name, elem, name)
+		if star, ok := e.Elt.(*ast.StarExpr); ok {
+			// Element is a pointer: a plain copy() would alias t's elements
+			// into out, so give each one a new backing value instead.
+			fmt.Fprintf(buf, "\t\tfor i, v := range t.%s {\n", name)
+			fmt.Fprintf(buf, "\t\t\tif v == nil {\n")
+			fmt.Fprintf(buf, "\t\t\t\tcontinue\n")
+			fmt.Fprintf(buf, "\t\t\t}\n")
+			if isExported(star.X) {
+				fmt.Fprintf(buf, "\t\t\tout.%s[i] = v.Clone()\n", name)
+			} else {
+				fmt.Fprintf(buf, "\t\t\tvc := *v\n")
+				fmt.Fprintf(buf, "\t\t\tout.%s[i] = &vc\n", name)
+			}
+			fmt.Fprintf(buf, "\t\t}\n")
+		} else {
+			fmt.Fprintf(buf, "\t\tcopy(out.%s, t.%s)\n", name, name)
+		}
+		fmt.Fprintf(buf, "\t}\n")
+
+	case *ast.MapType:
+		key, val := exprString(e.Key), exprString(e.Value)
+		fmt.Fprintf(buf, "\tif t.%s != nil {\n", name)
+		fmt.Fprintf(buf, "\t\tout.%s = make(map[%s]%s, len(t.%s))\n", name, key, val, name)
+		fmt.Fprintf(buf, "\t\tfor k, v := range t.%s {\n", name)
+		if star, ok := e.Value.(*ast.StarExpr); ok {
+			// Value is a pointer: a plain assignment would alias t's values
+			// into out, so give each one a new backing value instead.
+			fmt.Fprintf(buf, "\t\t\tif v == nil {\n")
+			fmt.Fprintf(buf, "\t\t\t\tout.%s[k] = nil\n", name)
+			fmt.Fprintf(buf, "\t\t\t\tcontinue\n")
+			fmt.Fprintf(buf, "\t\t\t}\n")
+			if isExported(star.X) {
+				fmt.Fprintf(buf, "\t\t\tout.%s[k] = v.Clone()\n", name)
+			} else {
+				fmt.Fprintf(buf, "\t\t\tvc := *v\n")
+				fmt.Fprintf(buf, "\t\t\tout.%s[k] = &vc\n", name)
+			}
+		} else {
+			fmt.Fprintf(buf, "\t\t\tout.%s[k] = v\n", name)
+		}
+		fmt.Fprintf(buf, "\t\t}\n")
+		fmt.Fprintf(buf, "\t}\n")
+
+	default:
+		// Scalar, string, or other value type: already copied by *out = *t.
+	}
+}
+
+// isExported reports whether e is an identifier starting with an upper-case
+// letter, a rough proxy for "this is a struct type with its own
+// DeepCopyInto" versus a basic type like byte or rune.
+func isExported(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name != "" && strings.ToUpper(id.Name[:1]) == id.Name[:1]
+}
+
+func exprString(e ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), e)
+	return buf.String()
+}
+
+func writeClone(buf *bytes.Buffer, t structType) {
+	fmt.Fprintf(buf, "// Clone returns a deep copy of t.\n")
+	fmt.Fprintf(buf, "func (t *%s) Clone() *%s {\n", t.name, t.name)
+	fmt.Fprintf(buf, "\tif t == nil {\n\t\treturn nil\n\t}\n")
+	fmt.Fprintf(buf, "\tout := new(%s)\n", t.name)
+	fmt.Fprintf(buf, "\tt.DeepCopyInto(out)\n")
+	fmt.Fprintf(buf, "\treturn out\n")
+	fmt.Fprintf(buf, "}\n\n")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fixtureSrc = `package fixture
+
+//deepcopy:generate
+type Node struct {
+	ID       int
+	Name     string
+	Children []*Node
+	Tags     map[string]*Node
+	Scores   []*int
+	Limits   map[string]*int
+}
+`
+
+// TestRunClonesPointerElements runs the generator against a small fixture
+// package and checks that slice and map fields whose element is a pointer —
+// whether to an annotated type with its own Clone, or to a plain type like
+// int — are deep-copied instead of aliased via a plain copy() or map
+// assignment.
+func TestRunClonesPointerElements(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fixture.go"), []byte(fixtureSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "zz_generated.deepcopy.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := string(out)
+
+	if !strings.Contains(generated, "out.Children[i] = v.Clone()") {
+		t.Errorf("generated DeepCopyInto does not clone slice elements:\n%s", generated)
+	}
+	if strings.Contains(generated, "copy(out.Children, t.Children)") {
+		t.Errorf("generated DeepCopyInto shallow-copies Children via copy(), aliasing elements:\n%s", generated)
+	}
+
+	if !strings.Contains(generated, "out.Tags[k] = v.Clone()") {
+		t.Errorf("generated DeepCopyInto does not clone map values:\n%s", generated)
+	}
+	if strings.Contains(generated, "out.Tags[k] = v\n") {
+		t.Errorf("generated DeepCopyInto shallow-assigns Tags values, aliasing them:\n%s", generated)
+	}
+
+	if !strings.Contains(generated, "out.Scores[i] = &vc") {
+		t.Errorf("generated DeepCopyInto does not give []*int elements a new backing value:\n%s", generated)
+	}
+	if strings.Contains(generated, "copy(out.Scores, t.Scores)") {
+		t.Errorf("generated DeepCopyInto shallow-copies Scores via copy(), aliasing elements:\n%s", generated)
+	}
+
+	if !strings.Contains(generated, "out.Limits[k] = &vc") {
+		t.Errorf("generated DeepCopyInto does not give map[string]*int values a new backing value:\n%s", generated)
+	}
+	if strings.Contains(generated, "out.Limits[k] = v\n") {
+		t.Errorf("generated DeepCopyInto shallow-assigns Limits values, aliasing them:\n%s", generated)
+	}
+}
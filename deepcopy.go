@@ -1,19 +1,134 @@
-// package deepcopy makes deep copies of somethings: unexported field values are not copied.
+// package deepcopy makes deep copies of somethings. Unexported field values
+// are not copied unless Config.CopyUnexported is set.
 package deepcopy
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
 	"time"
+	"unsafe"
 )
 
+// Config controls the behavior of a deep copy. The zero value is the same
+// set of defaults used by the package-level DeepCopy and DeepClone.
+type Config struct {
+	// IgnoreEmpty skips zero-valued source fields during struct copying,
+	// leaving any pre-existing value in the corresponding dst field
+	// untouched instead of overwriting it with the zero value.
+	IgnoreEmpty bool
+
+	// MaxDepth bounds how deeply Copy will recurse before giving up with an
+	// error. Zero, the default, means unbounded.
+	MaxDepth int
+
+	// CopyUnexported makes Copy read and write unexported struct fields via
+	// unsafe, instead of leaving them untouched in dst.
+	CopyUnexported bool
+
+	// Converters are consulted when a struct field's dst and src types
+	// differ, in place of the usual type-mismatch error. Their presence
+	// also lets dst and src themselves be differently named struct types:
+	// fields are then matched up by name instead of position, and any pair
+	// whose types still differ falls back to Converters.
+	Converters []TypeConverter
+
+	// LockedCopy locks a struct that embeds sync.Locker for the duration of
+	// its field copy, and resets the destination's sync.Mutex, sync.RWMutex,
+	// or sync.Once fields to their zero value instead of copying them.
+	// Without it, Copy silently copies locked mutexes and already-fired
+	// sync.Once values via plain assignment.
+	LockedCopy bool
+
+	// Channels controls how Copy handles channel-typed values. The zero
+	// value, ShareChannel, copies a channel by reference, the same as a
+	// plain assignment. It also governs func-typed values, though only
+	// ErrorOnChannel has an effect on them: funcs are always shared under
+	// ShareChannel and NewChannel, since there's no way to allocate a new
+	// one.
+	Channels ChannelPolicy
+}
+
+// ChannelPolicy controls how Config copies channel-typed values.
+type ChannelPolicy int
+
+const (
+	// ShareChannel copies a channel value by reference, so dst and src read
+	// from and write to the same channel. This is the default.
+	ShareChannel ChannelPolicy = iota
+
+	// NewChannel allocates a new, empty channel in dst with the same
+	// capacity and direction as src, instead of aliasing it.
+	NewChannel
+
+	// ErrorOnChannel rejects any value containing a channel instead of
+	// silently aliasing or reallocating it.
+	ErrorOnChannel
+)
+
+// TypeConverter converts a value of SrcType into a value of DstType. It is
+// consulted when copying a struct field whose dst and src types differ, for
+// example time.Time -> string.
+type TypeConverter struct {
+	SrcType reflect.Type
+	DstType reflect.Type
+	Fn      func(src any) (any, error)
+}
+
+func (cfg Config) converter(src, dst reflect.Type) (func(any) (any, error), bool) {
+	for _, tc := range cfg.Converters {
+		if tc.SrcType == src && tc.DstType == dst {
+			return tc.Fn, true
+		}
+	}
+	return nil, false
+}
+
 // DeepClone returns a deep copy of whatever is passed to it and returns the copy
 // in an any. The returned value will need to be asserted to the correct type.
 //
 // DeepClone calls one of methods "Clone() *T" or "Clone() T"
 // to delegating copy process to type.
-func DeepClone(src any) any {
+func DeepClone(src any) (any, error) {
+	return (Config{}).Clone(src)
+}
+
+// DeepCopy copies the contents of src into dst
+// See DeepClone function's documentation for more information.
+func DeepCopy(dst, src any) error {
+	return (Config{}).Copy(dst, src)
+}
+
+// DeepCopyContext is like DeepCopy, but periodically checks ctx during the
+// copy and aborts with ctx.Err() once it's been canceled. This is useful
+// when cloning very large graphs in request handlers with deadlines.
+func DeepCopyContext(ctx context.Context, dst, src any) error {
+	return (Config{}).copy(ctx, dst, src)
+}
+
+// MustDeepClone is like DeepClone but panics instead of returning an error.
+func MustDeepClone(src any) any {
+	dst, err := DeepClone(src)
+	if err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+// MustDeepCopy is like DeepCopy but panics instead of returning an error.
+func MustDeepCopy(dst, src any) {
+	if err := DeepCopy(dst, src); err != nil {
+		panic(err)
+	}
+}
+
+// Clone is like DeepClone but configured by cfg. Failures, including a nil
+// src, are reported as an error rather than a panic.
+func (cfg Config) Clone(src any) (any, error) {
+	if src == nil {
+		return nil, fmt.Errorf("deepcopy: src is nil")
+	}
 	srcType := reflect.TypeOf(src)
 	if reflect.Pointer == srcType.Kind() {
 		srcType = srcType.Elem()
@@ -26,84 +141,155 @@ func DeepClone(src any) any {
 	case reflect.Map:
 		dst.Elem().Set(reflect.MakeMap(dst.Elem().Type()))
 	}
-	DeepCopy(dst.Interface(), src)
+	if err := cfg.Copy(dst.Interface(), src); err != nil {
+		return nil, err
+	}
 
 	if timeType == dst.Elem().Type() {
-		return dst.Elem().Interface()
+		return dst.Elem().Interface(), nil
 	}
 
 	switch dst.Elem().Kind() {
 	case reflect.Interface:
 		fallthrough
 	case reflect.Struct:
-		return dst.Interface()
+		return dst.Interface(), nil
 	case reflect.Slice:
 		fallthrough
 	case reflect.Map:
 		fallthrough
 	default:
-		return dst.Elem().Interface()
+		return dst.Elem().Interface(), nil
 	}
 }
 
-// DeepCopy copies the contents of src into dst
-// See DeepClone function's documentation for more information.
-func DeepCopy(dst, src any) {
+// Copy is like DeepCopy but configured by cfg. Failures are reported as an
+// error rather than a panic.
+func (cfg Config) Copy(dst, src any) error {
+	return cfg.copy(context.Background(), dst, src)
+}
+
+func (cfg Config) copy(ctx context.Context, dst, src any) (err error) {
+	c, put := newCopyState(cfg)
+	defer put()
+	c.ctx = ctx
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case copyError:
+				err = r.error
+			case error:
+				err = r
+			default:
+				// A non-error panic, e.g. from a user Clone() method or a
+				// reflect operation on mismatched types; still recoverable.
+				err = fmt.Errorf("deepcopy: %v", r)
+			}
+		}
+	}()
+
 	dstv := reflect.ValueOf(dst)
 	srcv := reflect.ValueOf(src)
 
 	if reflect.Pointer != dstv.Kind() || dstv.IsNil() {
-		panic("dst not non-nil pointer")
+		c.error(fmt.Errorf("deepcopy: dst not non-nil pointer"))
 	}
 
 	if reflect.Pointer == srcv.Kind() && srcv.IsNil() {
-		panic("src is nil pointer")
+		c.error(fmt.Errorf("deepcopy: src is nil pointer"))
 	}
 
 	if reflect.Pointer == srcv.Kind() {
-		if dt, st := dstv.Type().Elem(), srcv.Type().Elem(); dt != st {
-			panic(fmt.Sprintf("type mistmatch %s != %s", dt, st))
+		// Differently named struct types are allowed through here: their
+		// fields are matched up by name (and, where needed, a registered
+		// Converter) in the Struct case of deepValueCopy, instead of by
+		// position.
+		if dt, st := dstv.Type().Elem(), srcv.Type().Elem(); dt != st && !sameShapeStructs(cfg, dt, st) {
+			c.error(fmt.Errorf("deepcopy: type mistmatch %s != %s", dt, st))
 		}
 		if srcv.Interface() == dstv.Interface() {
-			return
+			return nil
+		}
+		if dstv.Type() == srcv.Type() {
+			// Seed seen with the root pointer itself, the same way the
+			// reflect.Pointer case in deepValueCopy seeds each pointer it
+			// allocates, so a cycle that comes back around to src (e.g.
+			// src.Next == src) resolves to dstv instead of allocating a second,
+			// distinct copy of the root.
+			c.seen[srcv.UnsafePointer()] = dstv
 		}
 		srcv = srcv.Elem()
-	} else if dt, st := dstv.Type().Elem(), srcv.Type(); dt != st {
-		panic(fmt.Sprintf("type mistmatch %s != %s", dt, st))
+	} else if dt, st := dstv.Type().Elem(), srcv.Type(); dt != st && !sameShapeStructs(cfg, dt, st) {
+		c.error(fmt.Errorf("deepcopy: type mistmatch %s != %s", dt, st))
 	}
 
-	c, put := newCopyState()
-	defer put()
 	c.deepValueCopy(dstv.Elem(), srcv)
+	return nil
+}
+
+// copyError lets deepValueCopy panic with an error and have Copy recover it
+// back into a plain error return, the same way encoding/json's encoder
+// turns internal panics into a Marshal error.
+type copyError struct{ error }
+
+func (c *copyState) error(err error) {
+	panic(copyError{err})
 }
 
 type copyState struct {
-	// Keep track of what pointers we've seen in the current recursive call
-	// path, to avoid cycles that could lead to a stack overflow. Only do
-	// the relatively expensive map operations if ptrLevel is larger than
-	// startDetectingCyclesAfter, so that we skip the work if we're within a
-	// reasonable amount of nested pointers deep.
-	ptrLevel uint
-	ptrSeen  map[any]struct{}
+	cfg Config
+
+	// depth is the current recursion depth, bounded by cfg.MaxDepth.
+	depth uint
+
+	// seen maps the address of every pointer, slice, and map value we've
+	// copied during this Copy call to the destination Value we allocated
+	// for it, so that a source graph where several fields point to the
+	// same value produces a destination graph with the same sharing,
+	// instead of a separate copy per reference. This also handles true
+	// cycles: when the recursion reaches an address already in seen, it
+	// reuses the recorded destination instead of recursing again.
+	seen map[unsafe.Pointer]reflect.Value
+
+	// ctx and n support DeepCopyContext: n counts elements copied out of
+	// slices, arrays, and maps, and every contextCheckInterval of them we
+	// check ctx for cancellation.
+	ctx context.Context
+	n   uint
 }
 
-const startDetectingCyclesAfter = 1000
+// contextCheckInterval is how many slice/array/map elements deepValueCopy copies
+// between calls to ctx.Err(), so that checking cancellation doesn't dominate
+// the cost of copying small elements.
+const contextCheckInterval = 1024
 
 var copyStatePool sync.Pool
 
-func newCopyState() (c *copyState, put func()) {
+func newCopyState(cfg Config) (c *copyState, put func()) {
 	if v := copyStatePool.Get(); v != nil {
 		c = v.(*copyState)
-		if len(c.ptrSeen) > 0 {
-			panic("ptrEncoder.encode should have emptied ptrSeen via defers")
-		}
 	} else {
-		c = &copyState{ptrSeen: make(map[any]struct{})}
+		c = &copyState{}
 	}
+	c.cfg = cfg
+	c.depth = 0
+	c.seen = make(map[unsafe.Pointer]reflect.Value)
+	c.ctx = context.Background()
+	c.n = 0
 	put = func() { copyStatePool.Put(c) }
 	return c, put
 }
 
+func (c *copyState) checkContext() {
+	c.n++
+	if c.n%contextCheckInterval == 0 {
+		if err := c.ctx.Err(); err != nil {
+			c.error(err)
+		}
+	}
+}
+
 type methodType struct {
 	method   reflect.Method
 	indirect bool
@@ -176,11 +362,106 @@ func tryInvokeCloneMethod(dst, src reflect.Value) bool {
 
 var timeType = reflect.TypeOf(time.Time{})
 
+// copiersMu guards copiers, the registry of custom copier functions
+// consulted by deepValueCopy before it falls back to its kind-switch.
+var (
+	copiersMu sync.RWMutex
+	copiers   = map[reflect.Type]func(any) (any, error){}
+)
+
+// RegisterCopier registers fn as the copier for values of type typ. When
+// deepValueCopy later encounters a value whose type, or whose pointer type,
+// matches typ, it calls fn instead of recursing into the value. This lets
+// callers customize how a type they don't own (e.g. sql.NullString,
+// big.Int, or a protobuf message with internal state) is cloned, without
+// needing that type to implement Clone.
+//
+// RegisterCopier is safe for concurrent use.
+func RegisterCopier(typ reflect.Type, fn func(any) (any, error)) {
+	copiersMu.Lock()
+	defer copiersMu.Unlock()
+	copiers[typ] = fn
+}
+
+// DeregisterCopier removes any copier previously registered for typ via
+// RegisterCopier.
+//
+// DeregisterCopier is safe for concurrent use.
+func DeregisterCopier(typ reflect.Type) {
+	copiersMu.Lock()
+	defer copiersMu.Unlock()
+	delete(copiers, typ)
+}
+
+func lookupCopier(t reflect.Type) (fn func(any) (any, error), ok bool) {
+	copiersMu.RLock()
+	defer copiersMu.RUnlock()
+	fn, ok = copiers[t]
+	return
+}
+
+// tryInvokeCopier calls the copier registered for src's type, if any, and
+// assigns its result into dst. It mirrors tryInvokeCloneMethod's handling
+// of T vs *T mismatches between src, the registered type, and dst.
+func (c *copyState) tryInvokeCopier(dst, src reflect.Value) bool {
+	fn, ok := lookupCopier(src.Type())
+	if !ok {
+		return false
+	}
+
+	out, err := fn(src.Interface())
+	if err != nil {
+		c.error(err)
+	}
+
+	ret := reflect.ValueOf(out)
+	switch dst.Type() {
+	case ret.Type():
+	case reflect.PointerTo(ret.Type()):
+		newRet := reflect.New(ret.Type()).Elem()
+		newRet.Set(ret)
+		ret = newRet.Addr()
+	}
+	switch ret.Type() {
+	case dst.Type():
+	case reflect.PointerTo(dst.Type()):
+		ret = ret.Elem()
+	}
+	dst.Set(ret)
+	return true
+}
+
+// sameShapeStructs reports whether dt and st are both struct types that cfg
+// is prepared to bridge: cfg must have at least one registered Converter, so
+// that a caller who simply passes mismatched types by mistake still gets the
+// usual type-mismatch error instead of a silent no-op. When it returns true,
+// callers defer to deepValueCopy's Struct case, which matches fields by name
+// and consults cfg.Converters for any that still differ in type.
+func sameShapeStructs(cfg Config, dt, st reflect.Type) bool {
+	return len(cfg.Converters) > 0 && reflect.Struct == dt.Kind() && reflect.Struct == st.Kind()
+}
+
 func (c *copyState) deepValueCopy(dst, src reflect.Value) {
-	if dst.Type() != src.Type() {
+	if dst.Type() != src.Type() && !sameShapeStructs(c.cfg, dst.Type(), src.Type()) {
 		panic(fmt.Sprintf("type mistmatch %s != %s", dst.Type(), src.Type()))
 	}
 
+	c.depth++
+	defer func() { c.depth-- }()
+	if c.cfg.MaxDepth > 0 && c.depth > uint(c.cfg.MaxDepth) {
+		c.error(fmt.Errorf("deepcopy: max depth %d exceeded", c.cfg.MaxDepth))
+	}
+
+	if src.Kind() != reflect.Pointer && src.CanAddr() {
+		if c.tryInvokeCopier(dst, src.Addr()) {
+			return
+		}
+	}
+
+	if c.tryInvokeCopier(dst, src) {
+		return
+	}
+
 	if src.Kind() != reflect.Pointer && src.CanAddr() {
 		if tryInvokeCloneMethod(dst, src.Addr()) {
 			return
@@ -191,41 +472,18 @@ func (c *copyState) deepValueCopy(dst, src reflect.Value) {
 		return
 	}
 
-	switch sk := src.Kind(); sk {
+	var ptr unsafe.Pointer
+	switch src.Kind() {
 	case reflect.Pointer, reflect.Slice, reflect.Map:
 		if src.IsNil() {
 			dst.SetZero()
 			return
 		}
 
-		if c.ptrLevel++; c.ptrLevel > startDetectingCyclesAfter {
-			var ptr any
-			switch sk {
-			case reflect.Pointer:
-				// We're a large number of nested ptrEncoder.encode calls deep;
-				// start checking if we've run into a pointer cycle.
-				ptr = src.Interface()
-
-			case reflect.Slice:
-				// We're a large number of nested ptrEncoder.encode calls deep;
-				// start checking if we've run into a pointer cycle.
-				// Here we use a struct to memorize the pointer to the first element of the slice
-				// and its length.
-				ptr = struct {
-					ptr any // always an unsafe.Pointer, but avoids a dependency on package unsafe
-					len int
-				}{src.UnsafePointer(), src.Len()}
-
-			case reflect.Map:
-				// We're a large number of nested ptrEncoder.encode calls deep;
-				// start checking if we've run into a pointer cycle.
-				ptr = src.UnsafePointer()
-			}
-			if _, ok := c.ptrSeen[ptr]; ok {
-				return
-			}
-			c.ptrSeen[ptr] = struct{}{}
-			defer delete(c.ptrSeen, ptr)
+		ptr = src.UnsafePointer()
+		if v, ok := c.seen[ptr]; ok {
+			dst.Set(v)
+			return
 		}
 	}
 
@@ -247,18 +505,80 @@ func (c *copyState) deepValueCopy(dst, src reflect.Value) {
 			return
 		}
 
+		if c.cfg.LockedCopy && src.CanAddr() {
+			if locker, ok := src.Addr().Interface().(sync.Locker); ok {
+				locker.Lock()
+				defer locker.Unlock()
+			}
+		}
+
+		sameType := dst.Type() == src.Type()
+		if c.cfg.CopyUnexported && !src.CanAddr() {
+			// Reading unexported fields via UnsafeAddr needs an addressable
+			// src, e.g. a map value or a struct passed by value.
+			tmp := reflect.New(src.Type()).Elem()
+			tmp.Set(src)
+			src = tmp
+		}
 		for i := 0; i < src.NumField(); i++ {
-			if !dst.Field(i).CanSet() {
+			sf := src.Field(i)
+			var df reflect.Value
+			if sameType {
+				df = dst.Field(i)
+			} else {
+				// dst and src are differently named struct types: match
+				// fields by name instead of position, and skip any src
+				// field that dst has no counterpart for.
+				df = dst.FieldByName(src.Type().Field(i).Name)
+				if !df.IsValid() {
+					continue
+				}
+			}
+			if !df.CanSet() {
+				if !c.cfg.CopyUnexported {
+					continue
+				}
+				df = reflect.NewAt(df.Type(), unsafe.Pointer(df.UnsafeAddr())).Elem()
+				sf = reflect.NewAt(sf.Type(), unsafe.Pointer(sf.UnsafeAddr())).Elem()
+			}
+
+			if c.cfg.LockedCopy && isSyncPrimitive(sf.Type()) {
+				// Reset dst's mutex/once to its zero value rather than
+				// copying (possibly locked or already-fired) state.
+				df.SetZero()
 				continue
 			}
-			c.deepValueCopy(dst.Field(i), src.Field(i))
+
+			if c.cfg.IgnoreEmpty && sf.IsZero() {
+				continue
+			}
+
+			if df.Type() != sf.Type() {
+				fn, ok := c.cfg.converter(sf.Type(), df.Type())
+				if !ok {
+					c.error(fmt.Errorf("deepcopy: field %s: type mistmatch %s != %s", src.Type().Field(i).Name, df.Type(), sf.Type()))
+				}
+				out, err := fn(sf.Interface())
+				if err != nil {
+					c.error(err)
+				}
+				df.Set(reflect.ValueOf(out))
+				continue
+			}
+
+			c.deepValueCopy(df, sf)
 		}
 
 	case reflect.Map:
 		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		// Record the map value itself, not dst's location, which may be
+		// reused (e.g. mapElem below) and later hold something else.
+		c.seen[ptr] = reflect.ValueOf(dst.Interface())
 
 		var mapElem reflect.Value
 		for mi := src.MapRange(); mi.Next(); {
+			c.checkContext()
+
 			if !mapElem.IsValid() {
 				mapElem = reflect.New(src.Type().Elem()).Elem()
 			} else {
@@ -271,9 +591,11 @@ func (c *copyState) deepValueCopy(dst, src reflect.Value) {
 	case reflect.Slice, reflect.Array:
 		if reflect.Slice == sk {
 			dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+			c.seen[ptr] = reflect.ValueOf(dst.Interface())
 		}
 
 		for i := 0; i < src.Len(); i++ {
+			c.checkContext()
 			c.deepValueCopy(dst.Index(i), src.Index(i))
 		}
 
@@ -281,9 +603,50 @@ func (c *copyState) deepValueCopy(dst, src reflect.Value) {
 		if dst.IsNil() {
 			dst.Set(reflect.New(src.Type().Elem()))
 		}
+		c.seen[ptr] = reflect.ValueOf(dst.Interface())
 		c.deepValueCopy(dst.Elem(), src.Elem())
 
+	case reflect.Chan:
+		if src.IsNil() {
+			dst.SetZero()
+			return
+		}
+		switch c.cfg.Channels {
+		case NewChannel:
+			// MakeChan only accepts bidirectional types; a bidirectional
+			// channel is assignable to src's (possibly directional) type.
+			dst.Set(reflect.MakeChan(reflect.ChanOf(reflect.BothDir, src.Type().Elem()), src.Cap()))
+		case ErrorOnChannel:
+			c.error(fmt.Errorf("deepcopy: %s: channels not allowed", src.Type()))
+		default:
+			dst.Set(src)
+		}
+
+	case reflect.Func:
+		// Funcs close over unexported runtime state that can't be deep
+		// copied or reallocated, so NewChannel has no equivalent here, but
+		// ErrorOnChannel is still honored.
+		if ErrorOnChannel == c.cfg.Channels {
+			c.error(fmt.Errorf("deepcopy: %s: funcs not allowed", src.Type()))
+		}
+		dst.Set(src)
+
 	default:
 		dst.Set(src)
 	}
 }
+
+var (
+	mutexType   = reflect.TypeOf(sync.Mutex{})
+	rwMutexType = reflect.TypeOf(sync.RWMutex{})
+	onceType    = reflect.TypeOf(sync.Once{})
+)
+
+func isSyncPrimitive(t reflect.Type) bool {
+	switch t {
+	case mutexType, rwMutexType, onceType:
+		return true
+	default:
+		return false
+	}
+}
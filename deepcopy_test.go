@@ -1,8 +1,11 @@
 package deepcopy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,8 +38,8 @@ func TestBasic(t *testing.T) {
 		&iface1,
 	}
 	for _, test := range tests {
-		t.Run(fmt.Sprintf("DeepClone(%#v)", test), func(t *testing.T) {
-			testc := DeepClone(test)
+		t.Run(fmt.Sprintf("MustDeepClone(%#v)", test), func(t *testing.T) {
+			testc := MustDeepClone(test)
 			equal(t, test, testc)
 		})
 	}
@@ -52,8 +55,8 @@ func TestSlice(t *testing.T) {
 		[]string{},
 	}
 	for _, test := range tests {
-		t.Run(fmt.Sprintf("DeepClone(%#v)", test), func(t *testing.T) {
-			testc := DeepClone(test)
+		t.Run(fmt.Sprintf("MustDeepClone(%#v)", test), func(t *testing.T) {
+			testc := MustDeepClone(test)
 			equal(t, test, testc)
 		})
 	}
@@ -68,8 +71,8 @@ func TestMap(t *testing.T) {
 		map[string][]int(nil),
 	}
 	for _, test := range tests {
-		t.Run(fmt.Sprintf("DeepClone(%#v)", test), func(t *testing.T) {
-			testc := DeepClone(test)
+		t.Run(fmt.Sprintf("MustDeepClone(%#v)", test), func(t *testing.T) {
+			testc := MustDeepClone(test)
 			equal(t, test, testc)
 		})
 	}
@@ -133,7 +136,7 @@ func TestStruct(t *testing.T) {
 		T:  time.Now(),
 	}
 
-	dst := DeepClone(src).(*S2)
+	dst := MustDeepClone(src).(*S2)
 	equal(t, src, dst)
 }
 
@@ -152,7 +155,7 @@ func TestUnexportedFields(t *testing.T) {
 		c: []int{23},
 		d: map[string]string{"foo": "bar"},
 	}
-	dst := DeepClone(src).(*Unexported)
+	dst := MustDeepClone(src).(*Unexported)
 	if dst == src {
 		t.Fatal("expected different pointer")
 	}
@@ -183,7 +186,7 @@ func TestTimeCopy(t *testing.T) {
 		}
 
 		src := time.Date(tt.year, tt.month, tt.day, tt.hour, tt.min, tt.sec, tt.nsec, loc)
-		dst := DeepClone(src).(time.Time)
+		dst := MustDeepClone(src).(time.Time)
 		if !src.Equal(dst) {
 			t.Error("time copy error")
 		}
@@ -208,18 +211,468 @@ func TestClone(t *testing.T) {
 	t.Parallel()
 
 	bar := &Bar{"hello"}
-	bc := DeepClone(bar).(*Bar)
+	bc := MustDeepClone(bar).(*Bar)
 	if text != bc.A {
 		t.Errorf("got %q, want %q", bc.A, text)
 	}
 
 	foo := &Foo{&Bar{"hello"}}
-	fc := DeepClone(foo).(*Foo)
+	fc := MustDeepClone(foo).(*Foo)
 	if text != fc.A {
 		t.Errorf("got %q, want %q", fc.A, text)
 	}
 }
 
+type Password struct {
+	Hash string
+}
+
+type Account struct {
+	Name string
+	Password
+}
+
+func TestRegisterCopier(t *testing.T) {
+	RegisterCopier(reflect.TypeOf(Password{}), func(v any) (any, error) {
+		return Password{Hash: "REDACTED"}, nil
+	})
+	defer DeregisterCopier(reflect.TypeOf(Password{}))
+
+	src := &Password{Hash: "s3cr3t"}
+	dst := MustDeepClone(src).(*Password)
+	if "REDACTED" != dst.Hash {
+		t.Errorf("got %q, want %q", dst.Hash, "REDACTED")
+	}
+
+	// The registered copier also overrides the default struct-field
+	// recursion when Password shows up nested inside another struct.
+	srcAccount := &Account{Name: "alice", Password: Password{Hash: "s3cr3t"}}
+	dstAccount := MustDeepClone(srcAccount).(*Account)
+	if "REDACTED" != dstAccount.Password.Hash {
+		t.Errorf("got %q, want %q", dstAccount.Password.Hash, "REDACTED")
+	}
+	if "alice" != dstAccount.Name {
+		t.Errorf("got %q, want %q", dstAccount.Name, "alice")
+	}
+}
+
+func TestDeregisterCopier(t *testing.T) {
+	typ := reflect.TypeOf(Password{})
+	RegisterCopier(typ, func(v any) (any, error) {
+		return Password{Hash: "REDACTED"}, nil
+	})
+	DeregisterCopier(typ)
+
+	src := &Password{Hash: "s3cr3t"}
+	dst := MustDeepClone(src).(*Password)
+	if "s3cr3t" != dst.Hash {
+		t.Errorf("got %q, want %q", dst.Hash, "s3cr3t")
+	}
+}
+
+func TestConfigIgnoreEmpty(t *testing.T) {
+	t.Parallel()
+
+	type S struct {
+		A string
+		B int
+	}
+
+	dst := &S{A: "keep", B: 1}
+	src := &S{A: "", B: 2}
+
+	cfg := Config{IgnoreEmpty: true}
+	if err := cfg.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if "keep" != dst.A {
+		t.Errorf("got %q, want %q", dst.A, "keep")
+	}
+	if 2 != dst.B {
+		t.Errorf("got %d, want %d", dst.B, 2)
+	}
+}
+
+func TestConfigMaxDepth(t *testing.T) {
+	t.Parallel()
+
+	type Node struct {
+		Next *Node
+	}
+
+	src := &Node{Next: &Node{Next: &Node{}}}
+
+	cfg := Config{MaxDepth: 2}
+	var dst Node
+	if err := cfg.Copy(&dst, src); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestConfigCopyUnexported(t *testing.T) {
+	t.Parallel()
+
+	type unexported struct {
+		a string
+	}
+
+	src := &unexported{a: "foobar"}
+	var dst unexported
+
+	cfg := Config{CopyUnexported: true}
+	if err := cfg.Copy(&dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if "foobar" != dst.a {
+		t.Errorf("got %q, want %q", dst.a, "foobar")
+	}
+}
+
+func TestConfigConverters(t *testing.T) {
+	t.Parallel()
+
+	type Src struct {
+		When time.Time
+	}
+	type Dst struct {
+		When string
+	}
+
+	when := time.Date(2021, time.July, 4, 0, 0, 0, 0, time.UTC)
+	src := &Src{When: when}
+	var dst Dst
+
+	cfg := Config{
+		Converters: []TypeConverter{
+			{
+				SrcType: reflect.TypeOf(time.Time{}),
+				DstType: reflect.TypeOf(""),
+				Fn: func(v any) (any, error) {
+					return v.(time.Time).Format(time.RFC3339), nil
+				},
+			},
+		},
+	}
+	if err := cfg.Copy(dst, src); err == nil {
+		t.Fatal("expected an error for non-pointer dst, got nil")
+	}
+	if err := cfg.Copy(&dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if want := when.Format(time.RFC3339); want != dst.When {
+		t.Errorf("got %q, want %q", dst.When, want)
+	}
+}
+
+func TestDeepCopyContext(t *testing.T) {
+	t.Parallel()
+
+	src := make([]int, contextCheckInterval*4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var dst []int
+	err := DeepCopyContext(ctx, &dst, src)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSharedPointerIdentity(t *testing.T) {
+	t.Parallel()
+
+	type Leaf struct {
+		V int
+	}
+	type Diamond struct {
+		A, B *Leaf
+	}
+
+	leaf := &Leaf{V: 1}
+	src := &Diamond{A: leaf, B: leaf}
+
+	dst := MustDeepClone(src).(*Diamond)
+	if dst.A == src.A {
+		t.Fatal("expected a new Leaf, got the same pointer as src")
+	}
+	if dst.A != dst.B {
+		t.Errorf("expected dst.A and dst.B to share the same Leaf, got %p != %p", dst.A, dst.B)
+	}
+	if 1 != dst.A.V {
+		t.Errorf("got %d, want %d", dst.A.V, 1)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	t.Parallel()
+
+	type Node struct {
+		Next *Node
+	}
+
+	src := &Node{}
+	src.Next = src
+
+	dst := MustDeepClone(src).(*Node)
+	if dst.Next != dst {
+		t.Errorf("expected dst.Next to point back to dst, got %p != %p", dst.Next, dst)
+	}
+}
+
+func TestCycleMultiNode(t *testing.T) {
+	t.Parallel()
+
+	type Node struct {
+		Name string
+		Next *Node
+	}
+
+	a := &Node{Name: "a"}
+	b := &Node{Name: "b"}
+	a.Next = b
+	b.Next = a
+
+	da := MustDeepClone(a).(*Node)
+	if da.Next == a || da.Next == b {
+		t.Fatal("expected a new Node, got a pointer back into src")
+	}
+	if da.Next.Next != da {
+		t.Errorf("expected the 2-node cycle to close back on da, got %p != %p", da.Next.Next, da)
+	}
+
+	x := &Node{Name: "x"}
+	y := &Node{Name: "y"}
+	z := &Node{Name: "z"}
+	x.Next = y
+	y.Next = z
+	z.Next = x
+
+	dx := MustDeepClone(x).(*Node)
+	if dx.Next.Next.Next != dx {
+		t.Errorf("expected the 3-node cycle to close back on dx, got %p != %p", dx.Next.Next.Next, dx)
+	}
+}
+
+// genNode and reflNode are structurally identical; genNode's methods stand
+// in for what deepcopy-gen would emit for a "//deepcopy:generate" type, so
+// BenchmarkGeneratedClone and BenchmarkReflectiveClone can compare the two
+// copy strategies on the same shape of data.
+type genNode struct {
+	ID       int
+	Name     string
+	Tags     []string
+	Children []*genNode
+}
+
+func (t *genNode) DeepCopyInto(out *genNode) {
+	*out = *t
+	if t.Tags != nil {
+		out.Tags = make([]string, len(t.Tags))
+		copy(out.Tags, t.Tags)
+	}
+	if t.Children != nil {
+		out.Children = make([]*genNode, len(t.Children))
+		for i, c := range t.Children {
+			out.Children[i] = c.Clone()
+		}
+	}
+}
+
+func (t *genNode) Clone() *genNode {
+	if t == nil {
+		return nil
+	}
+	out := new(genNode)
+	t.DeepCopyInto(out)
+	return out
+}
+
+type reflNode struct {
+	ID       int
+	Name     string
+	Tags     []string
+	Children []*reflNode
+}
+
+func newGenTree(depth, breadth int) *genNode {
+	n := &genNode{ID: depth, Name: "node", Tags: []string{"a", "b", "c"}}
+	if depth > 0 {
+		n.Children = make([]*genNode, breadth)
+		for i := range n.Children {
+			n.Children[i] = newGenTree(depth-1, breadth)
+		}
+	}
+	return n
+}
+
+func newReflTree(depth, breadth int) *reflNode {
+	n := &reflNode{ID: depth, Name: "node", Tags: []string{"a", "b", "c"}}
+	if depth > 0 {
+		n.Children = make([]*reflNode, breadth)
+		for i := range n.Children {
+			n.Children[i] = newReflTree(depth-1, breadth)
+		}
+	}
+	return n
+}
+
+func BenchmarkGeneratedClone(b *testing.B) {
+	tree := newGenTree(4, 3)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Clone()
+	}
+}
+
+func BenchmarkReflectiveClone(b *testing.B) {
+	tree := newReflTree(4, 3)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MustDeepClone(tree)
+	}
+}
+
+func TestLockedCopy(t *testing.T) {
+	t.Parallel()
+
+	type Counter struct {
+		sync.Mutex
+		N int
+	}
+
+	src := &Counter{N: 5}
+	src.Lock()
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		src.N = 7 // mutated just before unlocking, to show Clone waited for it
+		src.Unlock()
+		close(released)
+	}()
+
+	cfg := Config{LockedCopy: true, CopyUnexported: true}
+	dst, err := cfg.Clone(src)
+	<-released
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := dst.(*Counter)
+	if 7 != c.N {
+		t.Errorf("got %d, want %d", c.N, 7)
+	}
+	if !c.TryLock() {
+		t.Error("expected dst's Mutex to be unlocked")
+	}
+}
+
+func TestChannelPolicy(t *testing.T) {
+	t.Parallel()
+
+	type Pipe struct {
+		C chan int
+	}
+
+	src := &Pipe{C: make(chan int, 3)}
+
+	share, err := (Config{}).Clone(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.(*Pipe).C != src.C {
+		t.Error("expected ShareChannel (the default) to alias src's channel")
+	}
+
+	fresh, err := (Config{Channels: NewChannel}).Clone(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	freshC := fresh.(*Pipe).C
+	if freshC == src.C {
+		t.Error("expected NewChannel to allocate a distinct channel")
+	}
+	if cap(freshC) != cap(src.C) {
+		t.Errorf("got cap %d, want %d", cap(freshC), cap(src.C))
+	}
+
+	if _, err := (Config{Channels: ErrorOnChannel}).Clone(src); err == nil {
+		t.Fatal("expected ErrorOnChannel to reject a channel-containing value, got nil error")
+	}
+
+	nilSrc := &Pipe{}
+	nilDst, err := (Config{Channels: NewChannel}).Clone(nilSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nilDst.(*Pipe).C != nil {
+		t.Error("expected a nil src channel to stay nil under NewChannel")
+	}
+}
+
+func TestChannelPolicyFunc(t *testing.T) {
+	t.Parallel()
+
+	type Hook struct {
+		Fn func() int
+	}
+
+	src := &Hook{Fn: func() int { return 42 }}
+
+	share, err := (Config{}).Clone(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.(*Hook).Fn() != src.Fn() {
+		t.Error("expected ShareChannel (the default) to share src's func")
+	}
+
+	if _, err := (Config{Channels: ErrorOnChannel}).Clone(src); err == nil {
+		t.Fatal("expected ErrorOnChannel to reject a func-containing value, got nil error")
+	}
+}
+
+func TestLockedCopyIntoNonZeroDst(t *testing.T) {
+	t.Parallel()
+
+	type Counter struct {
+		sync.Mutex
+		N int
+	}
+	type Once struct {
+		sync.Once
+		N int
+	}
+
+	src := &Counter{N: 5}
+	dst := &Counter{N: 1}
+	dst.Lock()
+
+	cfg := Config{LockedCopy: true, CopyUnexported: true}
+	if err := cfg.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if 5 != dst.N {
+		t.Errorf("got %d, want %d", dst.N, 5)
+	}
+	if !dst.TryLock() {
+		t.Error("expected a previously-locked dst Mutex to come out unlocked")
+	}
+
+	srcOnce := &Once{N: 5}
+	dstOnce := &Once{N: 1}
+	dstOnce.Do(func() {})
+
+	if err := cfg.Copy(dstOnce, srcOnce); err != nil {
+		t.Fatal(err)
+	}
+	fired := false
+	dstOnce.Do(func() { fired = true })
+	if !fired {
+		t.Error("expected a previously-fired dst Once to come out unfired")
+	}
+}
+
 func equal(t testing.TB, x, y any, opts ...cmp.Option) bool {
 	t.Helper()
 
@@ -9,7 +9,10 @@ import (
 func ExampleDeepCopy() {
 	var dst = make([]int, 5)
 	src := []int{1, 2, 3}
-	deepcopy.DeepCopy(&dst, src)
+	if err := deepcopy.DeepCopy(&dst, src); err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	fmt.Println(len(dst), cap(dst))
 	for _, v := range dst {
@@ -25,7 +28,12 @@ func ExampleDeepCopy() {
 
 func ExampleDeepClone() {
 	src := []int{1, 2, 3}
-	dst := deepcopy.DeepClone(src).([]int)
+	v, err := deepcopy.DeepClone(src)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	dst := v.([]int)
 
 	fmt.Println(len(dst), cap(dst))
 	for _, v := range dst {